@@ -0,0 +1,171 @@
+// Package acl implements gyxy's host access-control list: a set of
+// allow/deny rules (exact hosts, wildcard suffixes, regexes, and CIDRs)
+// loaded once, watched for hot reload, and evaluated first-match-wins.
+package acl
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// Verdict is the outcome of evaluating a rule.
+type Verdict int
+
+const (
+	Allow Verdict = iota
+	Deny
+)
+
+func (v Verdict) String() string {
+	if v == Deny {
+		return "deny"
+	}
+	return "allow"
+}
+
+// Decision is the result of checking a host/client pair against the
+// engine's rules.
+type Decision struct {
+	Verdict Verdict
+	Tag     string
+	Rule    string // the raw rule text that matched, "" if no rule matched
+}
+
+// Engine loads rules from a file and evaluates them against hosts/IPs.
+type Engine struct {
+	path   string
+	logger *zap.Logger
+
+	// defaultVerdict applies when no rule matches.
+	defaultVerdict Verdict
+
+	mu      sync.RWMutex
+	rules   []Rule
+	watcher *fsnotify.Watcher
+}
+
+// New loads rules from path and starts watching it for changes. The file
+// may not exist yet, in which case an empty rule set is used; the watch is
+// then not set up, so a file created later is not loaded until restart.
+func New(path string, logger *zap.Logger) (*Engine, error) {
+	e := &Engine{
+		path:           path,
+		logger:         logger,
+		defaultVerdict: Allow,
+	}
+
+	if err := e.reload(); err != nil {
+		return nil, fmt.Errorf("acl: loading rules %q: %w", path, err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("acl: creating watcher: %w", err)
+	}
+	if err := watcher.Add(path); err != nil {
+		logger.Warn("ACL file watch unavailable, rules will not hot-reload", zap.String("path", path), zap.Error(err))
+	} else {
+		e.watcher = watcher
+		go e.watchLoop()
+	}
+
+	return e, nil
+}
+
+func (e *Engine) watchLoop() {
+	for {
+		select {
+		case event, ok := <-e.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				if err := e.reload(); err != nil {
+					e.logger.Error("Failed to reload ACL rules", zap.Error(err))
+				} else {
+					e.logger.Info("ACL rules reloaded", zap.String("path", e.path))
+				}
+			}
+		case err, ok := <-e.watcher.Errors:
+			if !ok {
+				return
+			}
+			e.logger.Error("ACL watcher error", zap.Error(err))
+		}
+	}
+}
+
+func (e *Engine) reload() error {
+	rules, err := loadRules(e.path)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.mu.Unlock()
+	return nil
+}
+
+// Rules returns a snapshot of the currently loaded rules.
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]Rule, len(e.rules))
+	copy(out, e.rules)
+	return out
+}
+
+// Check evaluates host and destIP against the loaded rules in order,
+// returning the first match, or the engine's default verdict (Allow) if
+// nothing matches.
+func (e *Engine) Check(host string, destIP net.IP) Decision {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	for _, rule := range rules {
+		if rule.Matches(host, destIP) {
+			e.logger.Debug("ACL rule matched",
+				zap.String("host", host),
+				zap.String("verdict", rule.Verb.String()),
+				zap.String("tag", rule.Tag))
+			return Decision{Verdict: rule.Verb, Tag: rule.Tag, Rule: rule.Raw}
+		}
+	}
+
+	return Decision{Verdict: e.defaultVerdict}
+}
+
+// AddRule appends rule to the in-memory set and persists it to the rules
+// file, for the admin API.
+func (e *Engine) AddRule(rule Rule) error {
+	e.mu.Lock()
+	e.rules = append(e.rules, rule)
+	rules := make([]Rule, len(e.rules))
+	copy(rules, e.rules)
+	e.mu.Unlock()
+
+	return saveRules(e.path, rules)
+}
+
+// RemoveRule deletes the rule at index from the set and persists the
+// change, for the admin API.
+func (e *Engine) RemoveRule(index int) error {
+	e.mu.Lock()
+	if index < 0 || index >= len(e.rules) {
+		e.mu.Unlock()
+		return fmt.Errorf("acl: rule index %d out of range", index)
+	}
+	e.rules = append(e.rules[:index], e.rules[index+1:]...)
+	rules := make([]Rule, len(e.rules))
+	copy(rules, e.rules)
+	e.mu.Unlock()
+
+	return saveRules(e.path, rules)
+}
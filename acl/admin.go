@@ -0,0 +1,87 @@
+package acl
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// ruleDTO is the JSON shape used by the admin API.
+type ruleDTO struct {
+	Index   int    `json:"index,omitempty"`
+	Verb    string `json:"verb"`
+	Pattern string `json:"pattern"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+// RulesHandler serves the admin API for managing ACL rules at runtime:
+//
+//	GET    /gyxy/acl/rules        list all rules
+//	POST   /gyxy/acl/rules        add a rule (JSON body: {verb, pattern, tag})
+//	DELETE /gyxy/acl/rules?index=N remove the rule at index N
+func RulesHandler(e *Engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			listRules(e, w)
+		case http.MethodPost:
+			addRule(e, w, r)
+		case http.MethodDelete:
+			deleteRule(e, w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func listRules(e *Engine, w http.ResponseWriter) {
+	rules := e.Rules()
+	dtos := make([]ruleDTO, len(rules))
+	for i, r := range rules {
+		dtos[i] = ruleDTO{Index: i, Verb: r.Verb.String(), Pattern: r.Raw, Tag: r.Tag}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dtos)
+}
+
+func addRule(e *Engine, w http.ResponseWriter, r *http.Request) {
+	var dto ruleDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	verb := Allow
+	if dto.Verb == "deny" {
+		verb = Deny
+	}
+
+	rule, err := NewRule(verb, dto.Pattern, dto.Tag)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := e.AddRule(rule); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func deleteRule(e *Engine, w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(r.URL.Query().Get("index"))
+	if err != nil {
+		http.Error(w, "missing or invalid index", http.StatusBadRequest)
+		return
+	}
+
+	if err := e.RemoveRule(index); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
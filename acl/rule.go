@@ -0,0 +1,145 @@
+package acl
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rule is one ACL entry: if the host (or destination IP) matches Pattern,
+// Verb (allow/deny) applies and Tag is surfaced in logs.
+type Rule struct {
+	Raw  string
+	Verb Verdict
+	Tag  string
+
+	pattern string
+	regex   *regexp.Regexp
+	cidr    *net.IPNet
+}
+
+// Matches reports whether host or destIP satisfies the rule.
+func (r Rule) Matches(host string, destIP net.IP) bool {
+	switch {
+	case r.cidr != nil:
+		return destIP != nil && r.cidr.Contains(destIP)
+	case r.regex != nil:
+		return r.regex.MatchString(host)
+	case strings.HasPrefix(r.pattern, "*."):
+		suffix := r.pattern[1:] // ".example.com"
+		return strings.EqualFold(host, r.pattern[2:]) || strings.HasSuffix(strings.ToLower(host), strings.ToLower(suffix))
+	default:
+		return strings.EqualFold(host, r.pattern)
+	}
+}
+
+// NewRule parses a pattern into a Rule with the given verb and tag,
+// detecting CIDRs and /regex/ patterns automatically.
+func NewRule(verb Verdict, pattern, tag string) (Rule, error) {
+	rule := Rule{
+		Raw:     pattern,
+		Verb:    verb,
+		Tag:     tag,
+		pattern: pattern,
+	}
+
+	if _, cidr, err := net.ParseCIDR(pattern); err == nil {
+		rule.cidr = cidr
+		return rule, nil
+	}
+
+	if strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") && len(pattern) > 1 {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return Rule{}, fmt.Errorf("acl: invalid regex %q: %w", pattern, err)
+		}
+		rule.regex = re
+	}
+
+	return rule, nil
+}
+
+// loadRules reads the ACL rules file, one rule per line:
+//
+//	allow|deny pattern [tag]
+//
+// A bare "hostname" line with no verb is treated as a legacy entry from
+// the old `blocked` file format and is loaded as "deny hostname".
+func loadRules(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []Rule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		var verb Verdict
+		var pattern, tag string
+
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("acl: %q: %q rule needs a pattern", line, fields[0])
+			}
+			verb = Allow
+			pattern = fields[1]
+			tag = strings.Join(fields[2:], " ")
+		case "deny":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("acl: %q: %q rule needs a pattern", line, fields[0])
+			}
+			verb = Deny
+			pattern = fields[1]
+			tag = strings.Join(fields[2:], " ")
+		default:
+			// Legacy `blocked` file: a bare hostname per line, always deny.
+			verb = Deny
+			pattern = fields[0]
+			tag = strings.Join(fields[1:], " ")
+		}
+
+		rule, err := NewRule(verb, pattern, tag)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// saveRules persists rules back to path in the "verb pattern [tag]"
+// format, for the admin API's POST/DELETE handlers.
+func saveRules(path string, rules []Rule) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	for _, r := range rules {
+		line := fmt.Sprintf("%s %s", r.Verb, r.Raw)
+		if r.Tag != "" {
+			line += " " + r.Tag
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
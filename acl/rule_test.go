@@ -0,0 +1,136 @@
+package acl
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mustRule(t *testing.T, verb Verdict, pattern, tag string) Rule {
+	t.Helper()
+	r, err := NewRule(verb, pattern, tag)
+	if err != nil {
+		t.Fatalf("NewRule(%v, %q, %q): %v", verb, pattern, tag, err)
+	}
+	return r
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   Rule
+		host   string
+		destIP net.IP
+		want   bool
+	}{
+		{"exact host match", mustRule(t, Deny, "example.com", ""), "example.com", nil, true},
+		{"exact host case-insensitive", mustRule(t, Deny, "Example.COM", ""), "example.com", nil, true},
+		{"exact host mismatch", mustRule(t, Deny, "example.com", ""), "other.com", nil, false},
+		{"wildcard matches subdomain", mustRule(t, Deny, "*.example.com", ""), "sub.example.com", nil, true},
+		{"wildcard matches bare domain", mustRule(t, Deny, "*.example.com", ""), "example.com", nil, true},
+		{"wildcard does not match unrelated suffix", mustRule(t, Deny, "*.example.com", ""), "notexample.com", nil, false},
+		{"regex matches", mustRule(t, Deny, "/^api-\\d+\\.example\\.com$/", ""), "api-42.example.com", nil, true},
+		{"regex mismatches", mustRule(t, Deny, "/^api-\\d+\\.example\\.com$/", ""), "api-x.example.com", nil, false},
+		{"cidr contains ip", mustRule(t, Deny, "10.0.0.0/8", ""), "whatever.internal", net.ParseIP("10.1.2.3"), true},
+		{"cidr excludes ip", mustRule(t, Deny, "10.0.0.0/8", ""), "whatever.internal", net.ParseIP("192.168.1.1"), false},
+		{"cidr with nil destIP never matches", mustRule(t, Deny, "10.0.0.0/8", ""), "whatever.internal", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.host, tt.destIP); got != tt.want {
+				t.Errorf("Matches(%q, %v) = %v, want %v", tt.host, tt.destIP, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRuleInvalidRegex(t *testing.T) {
+	if _, err := NewRule(Deny, "/(unterminated/", ""); err == nil {
+		t.Error("NewRule with invalid regex pattern: expected error, got nil")
+	}
+}
+
+func writeRulesFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "acl-rules")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("writing rules fixture: %v", err)
+	}
+	return path
+}
+
+func TestLoadRules(t *testing.T) {
+	path := writeRulesFile(t, "allow example.com\n"+
+		"deny *.ads.example.com tracked\n"+
+		"# a comment\n"+
+		"\n"+
+		"bad-legacy-host.example\n")
+
+	rules, err := loadRules(path)
+	if err != nil {
+		t.Fatalf("loadRules: %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("loadRules: got %d rules, want 3", len(rules))
+	}
+
+	if rules[0].Verb != Allow || rules[0].Raw != "example.com" {
+		t.Errorf("rules[0] = %+v, want verb=allow pattern=example.com", rules[0])
+	}
+	if rules[1].Verb != Deny || rules[1].Raw != "*.ads.example.com" || rules[1].Tag != "tracked" {
+		t.Errorf("rules[1] = %+v, want verb=deny pattern=*.ads.example.com tag=tracked", rules[1])
+	}
+	if rules[2].Verb != Deny || rules[2].Raw != "bad-legacy-host.example" {
+		t.Errorf("rules[2] = %+v, want legacy bare-hostname line treated as deny", rules[2])
+	}
+}
+
+func TestLoadRulesMissingFile(t *testing.T) {
+	rules, err := loadRules(filepath.Join(t.TempDir(), "does-not-exist"))
+	if err != nil {
+		t.Fatalf("loadRules of missing file: %v, want nil error", err)
+	}
+	if rules != nil {
+		t.Errorf("loadRules of missing file: got %v, want nil", rules)
+	}
+}
+
+func TestLoadRulesRejectsMissingPattern(t *testing.T) {
+	tests := []string{"allow\n", "deny\n", "allow   \n"}
+	for _, contents := range tests {
+		t.Run(contents, func(t *testing.T) {
+			path := writeRulesFile(t, contents)
+			if _, err := loadRules(path); err == nil {
+				t.Errorf("loadRules(%q): expected error, got nil", contents)
+			}
+		})
+	}
+}
+
+func TestSaveRulesRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acl-rules")
+
+	rules := []Rule{
+		mustRule(t, Allow, "example.com", ""),
+		mustRule(t, Deny, "*.ads.example.com", "tracked"),
+	}
+
+	if err := saveRules(path, rules); err != nil {
+		t.Fatalf("saveRules: %v", err)
+	}
+
+	got, err := loadRules(path)
+	if err != nil {
+		t.Fatalf("loadRules after saveRules: %v", err)
+	}
+	if len(got) != len(rules) {
+		t.Fatalf("loadRules after saveRules: got %d rules, want %d", len(got), len(rules))
+	}
+	for i, r := range got {
+		if r.Verb != rules[i].Verb || r.Raw != rules[i].Raw || r.Tag != rules[i].Tag {
+			t.Errorf("rule %d = %+v, want %+v", i, r, rules[i])
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Package admin runs gyxy's operator-facing HTTP server (separate from the
+// proxy listener) exposing endpoints like the root CA certificate,
+// metrics, and profiling.
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// Server is a small wrapper around http.Server that lets subsystems
+// register handlers before it's started.
+type Server struct {
+	addr   string
+	logger *zap.Logger
+	mux    *http.ServeMux
+	srv    *http.Server
+}
+
+// New creates an admin server listening on addr. Call Handle to register
+// routes, then Start to begin serving.
+func New(addr string, logger *zap.Logger) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		addr:   addr,
+		logger: logger,
+		mux:    mux,
+		srv:    &http.Server{Addr: addr, Handler: mux},
+	}
+}
+
+// Handle registers an HTTP handler for pattern, same semantics as
+// http.ServeMux.Handle. Must be called before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc is the func-based equivalent of Handle.
+func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Start runs the admin server, blocking until it exits or ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		s.srv.Shutdown(context.Background())
+	}()
+
+	s.logger.Info("Admin server started", zap.String("addr", s.addr))
+	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/mohamedbeat/gyxy/auth"
+)
+
+// RequireAuth wraps handler so it only serves requests carrying valid
+// credentials per a, the same auth subsystem that gates client proxy
+// traffic. If a is nil (equivalent to --auth none://), requests pass
+// through unauthenticated.
+func RequireAuth(a auth.Auth, handler http.Handler) http.Handler {
+	if a == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.Validate(auth.Request{
+			Header:     r.Header.Get("Authorization"),
+			RemoteAddr: r.RemoteAddr,
+		}); !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gyxy-admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
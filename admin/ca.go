@@ -0,0 +1,12 @@
+package admin
+
+import "net/http"
+
+// CAHandler serves the PEM-encoded root CA certificate so clients can
+// install it in their trust store, e.g. GET /gyxy/ca.pem.
+func CAHandler(pemBytes func() []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Write(pemBytes())
+	})
+}
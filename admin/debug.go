@@ -0,0 +1,30 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mohamedbeat/gyxy/auth"
+)
+
+// RegisterDebug wires up /metrics, /debug/pprof/*, and /healthz, the
+// standard operator-facing endpoints for profiling the proxy under load.
+// a gates /metrics and /debug/pprof/* the same way it gates client proxy
+// traffic, since both leak sensitive operational detail; /healthz stays
+// unauthenticated since orchestrators probe it without credentials.
+func (s *Server) RegisterDebug(a auth.Auth) {
+	s.Handle("/metrics", RequireAuth(a, promhttp.Handler()))
+
+	s.Handle("/debug/pprof/", RequireAuth(a, http.HandlerFunc(pprof.Index)))
+	s.Handle("/debug/pprof/cmdline", RequireAuth(a, http.HandlerFunc(pprof.Cmdline)))
+	s.Handle("/debug/pprof/profile", RequireAuth(a, http.HandlerFunc(pprof.Profile)))
+	s.Handle("/debug/pprof/symbol", RequireAuth(a, http.HandlerFunc(pprof.Symbol)))
+	s.Handle("/debug/pprof/trace", RequireAuth(a, http.HandlerFunc(pprof.Trace)))
+
+	s.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+}
@@ -0,0 +1,49 @@
+// Package auth implements pluggable proxy authentication schemes for gyxy,
+// selected at startup via a scheme URI (e.g. "static://user:pass@/",
+// "basicfile:///etc/gyxy/htpasswd", "none://").
+package auth
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Request is the subset of an inbound proxy request that authenticators
+// need in order to validate credentials.
+type Request struct {
+	// Header is the raw value of the credentials header, if present:
+	// Proxy-Authorization for proxy traffic, Authorization for the admin server.
+	Header string
+	// RemoteAddr is the client's network address, for logging/lockout policies.
+	RemoteAddr string
+}
+
+// Auth validates proxy credentials for an inbound request.
+type Auth interface {
+	// Validate checks the request's credentials and returns the
+	// authenticated username and whether the request should be allowed.
+	Validate(req Request) (user string, ok bool)
+}
+
+// NewAuth builds an Auth from a scheme URI, dispatching on the scheme:
+//
+//	static://user:pass@/            fixed single-user/password pair
+//	basicfile:///path/to/htpasswd   htpasswd file, reloaded periodically
+//	none://                         authentication disabled
+func NewAuth(paramstr string) (Auth, error) {
+	u, err := url.Parse(paramstr)
+	if err != nil {
+		return nil, fmt.Errorf("auth: invalid scheme URI %q: %w", paramstr, err)
+	}
+
+	switch u.Scheme {
+	case "static":
+		return newStaticAuth(u)
+	case "basicfile":
+		return newBasicFileAuth(u)
+	case "none":
+		return noneAuth{}, nil
+	default:
+		return nil, fmt.Errorf("auth: unknown scheme %q", u.Scheme)
+	}
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// parseBasic decodes a "Basic <base64(user:pass)>" Proxy-Authorization
+// header value. It returns ok=false if the header is missing or malformed.
+func parseBasic(header string) (user, pass string, ok bool) {
+	const prefix = "Basic "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(header[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	cred := string(decoded)
+	idx := strings.IndexByte(cred, ':')
+	if idx < 0 {
+		return "", "", false
+	}
+
+	return cred[:idx], cred[idx+1:], true
+}
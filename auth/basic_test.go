@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func basicHeader(user, pass string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+}
+
+func TestParseBasic(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantUser string
+		wantPass string
+		wantOK   bool
+	}{
+		{"valid", basicHeader("alice", "hunter2"), "alice", "hunter2", true},
+		{"empty password", basicHeader("alice", ""), "alice", "", true},
+		{"missing header", "", "", "", false},
+		{"wrong scheme", "Bearer deadbeef", "", "", false},
+		{"not base64", "Basic not-base64!!!", "", "", false},
+		{"no colon in credentials", "Basic " + base64.StdEncoding.EncodeToString([]byte("aliceonly")), "", "", false},
+		{"case-insensitive scheme", "basic " + base64.StdEncoding.EncodeToString([]byte("alice:hunter2")), "alice", "hunter2", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, pass, ok := parseBasic(tt.header)
+			if ok != tt.wantOK || user != tt.wantUser || pass != tt.wantPass {
+				t.Errorf("parseBasic(%q) = (%q, %q, %v), want (%q, %q, %v)",
+					tt.header, user, pass, ok, tt.wantUser, tt.wantPass, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// reloadInterval is how often the htpasswd file on disk is re-read, so
+// credentials can be rotated without restarting the proxy.
+const reloadInterval = 30 * time.Second
+
+// basicFileAuth authenticates against an Apache-style htpasswd file,
+// e.g. basicfile:///etc/gyxy/htpasswd. The file is periodically reloaded
+// in the background so edits take effect without a restart.
+type basicFileAuth struct {
+	path string
+
+	mu    sync.RWMutex
+	users map[string]string // username -> bcrypt hash or plain-text password
+}
+
+func newBasicFileAuth(u *url.URL) (Auth, error) {
+	path := u.Path
+	if path == "" {
+		return nil, fmt.Errorf("auth: basicfile scheme requires a path (got %q)", u.String())
+	}
+
+	a := &basicFileAuth{path: path}
+	if err := a.reload(); err != nil {
+		return nil, fmt.Errorf("auth: loading htpasswd file %q: %w", path, err)
+	}
+
+	go a.reloadLoop()
+	return a, nil
+}
+
+func (a *basicFileAuth) reloadLoop() {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Best effort: keep serving the last-known-good set on error.
+		_ = a.reload()
+	}
+}
+
+func (a *basicFileAuth) reload() error {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.IndexByte(line, ':')
+		if idx < 0 {
+			continue
+		}
+
+		users[line[:idx]] = line[idx+1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.users = users
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *basicFileAuth) Validate(req Request) (string, bool) {
+	user, pass, ok := parseBasic(req.Header)
+	if !ok {
+		return "", false
+	}
+
+	a.mu.RLock()
+	hash, found := a.users[user]
+	a.mu.RUnlock()
+	if !found {
+		return "", false
+	}
+
+	if strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$") {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+			return "", false
+		}
+		return user, true
+	}
+
+	// Fall back to plain-text comparison for non-bcrypt entries.
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(pass)) != 1 {
+		return "", false
+	}
+	return user, true
+}
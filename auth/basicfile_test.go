@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeHtpasswd(t *testing.T, entries map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "htpasswd")
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating htpasswd fixture: %v", err)
+	}
+	defer f.Close()
+
+	for user, hash := range entries {
+		if _, err := f.WriteString(user + ":" + hash + "\n"); err != nil {
+			t.Fatalf("writing htpasswd fixture: %v", err)
+		}
+	}
+	return path
+}
+
+func TestBasicFileAuthValidate(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("generating bcrypt fixture hash: %v", err)
+	}
+
+	path := writeHtpasswd(t, map[string]string{
+		"alice": string(bcryptHash),
+		"bob":   "plaintextpass",
+	})
+
+	u, err := url.Parse("basicfile://" + path)
+	if err != nil {
+		t.Fatalf("parsing fixture URL: %v", err)
+	}
+	a, err := newBasicFileAuth(u)
+	if err != nil {
+		t.Fatalf("newBasicFileAuth: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		wantOK bool
+	}{
+		{"bcrypt user correct password", basicHeader("alice", "hunter2"), true},
+		{"bcrypt user wrong password", basicHeader("alice", "wrong"), false},
+		{"plaintext user correct password", basicHeader("bob", "plaintextpass"), true},
+		{"plaintext user wrong password", basicHeader("bob", "wrong"), false},
+		{"unknown user", basicHeader("carol", "whatever"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := a.Validate(Request{Header: tt.header}); ok != tt.wantOK {
+				t.Errorf("Validate(%q) ok = %v, want %v", tt.header, ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNoneAuthAlwaysAllows(t *testing.T) {
+	if _, ok := (noneAuth{}).Validate(Request{}); !ok {
+		t.Error("noneAuth.Validate() = false, want true")
+	}
+}
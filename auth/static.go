@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/url"
+)
+
+// staticAuth authenticates against a single, fixed username/password pair
+// supplied on the CLI, e.g. static://user:pass@/.
+type staticAuth struct {
+	user string
+	pass string
+}
+
+func newStaticAuth(u *url.URL) (Auth, error) {
+	if u.User == nil {
+		return nil, fmt.Errorf("auth: static scheme requires user:pass@ (got %q)", u.String())
+	}
+
+	pass, _ := u.User.Password()
+	return &staticAuth{
+		user: u.User.Username(),
+		pass: pass,
+	}, nil
+}
+
+func (a *staticAuth) Validate(req Request) (string, bool) {
+	user, pass, ok := parseBasic(req.Header)
+	if !ok {
+		return "", false
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(a.user)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(a.pass)) == 1
+	if !userOK || !passOK {
+		return "", false
+	}
+
+	return user, true
+}
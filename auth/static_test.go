@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNewStaticAuth(t *testing.T) {
+	if _, err := newStaticAuth(&url.URL{Scheme: "static"}); err == nil {
+		t.Error("newStaticAuth with no user info: expected error, got nil")
+	}
+
+	u, _ := url.Parse("static://alice:hunter2@/")
+	if _, err := newStaticAuth(u); err != nil {
+		t.Fatalf("newStaticAuth(%q) = %v, want no error", u, err)
+	}
+}
+
+func TestStaticAuthValidate(t *testing.T) {
+	u, _ := url.Parse("static://alice:hunter2@/")
+	a, err := newStaticAuth(u)
+	if err != nil {
+		t.Fatalf("newStaticAuth: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		wantOK bool
+	}{
+		{"correct credentials", basicHeader("alice", "hunter2"), true},
+		{"wrong password", basicHeader("alice", "wrong"), false},
+		{"wrong user", basicHeader("bob", "hunter2"), false},
+		{"no credentials", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, ok := a.Validate(Request{Header: tt.header})
+			if ok != tt.wantOK {
+				t.Errorf("Validate(%q) ok = %v, want %v", tt.header, ok, tt.wantOK)
+			}
+			if ok && user != "alice" {
+				t.Errorf("Validate(%q) user = %q, want %q", tt.header, user, "alice")
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+// Package certstore generates and caches the leaf TLS certificates gyxy
+// mints for MITM interception, backed by an auto-generated root CA.
+package certstore
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/mohamedbeat/gyxy/metrics"
+)
+
+// KeyType selects the key algorithm used when signing leaf certificates.
+type KeyType int
+
+const (
+	// ECDSAP256 signs leaves with an ECDSA P-256 key, roughly 10x faster
+	// to handshake than RSA-2048, and is the default.
+	ECDSAP256 KeyType = iota
+	RSA2048
+	RSA4096
+)
+
+// ParseKeyType parses the "ecdsa-p256", "rsa2048", or "rsa4096" flag values
+// operators pass to select a key algorithm.
+func ParseKeyType(s string) (KeyType, error) {
+	switch s {
+	case "ecdsa-p256":
+		return ECDSAP256, nil
+	case "rsa2048":
+		return RSA2048, nil
+	case "rsa4096":
+		return RSA4096, nil
+	default:
+		return 0, fmt.Errorf("certstore: unknown key type %q (want ecdsa-p256, rsa2048, or rsa4096)", s)
+	}
+}
+
+const (
+	rootCertFile = "rootCA.pem"
+	rootKeyFile  = "rootCA.key"
+
+	// defaultCacheSize bounds the number of cached leaf certificates.
+	defaultCacheSize = 4096
+
+	// expireEarly is how far before NotAfter a cached entry is considered
+	// stale, so in-flight requests never hand out an about-to-expire leaf.
+	expireEarly = 5 * time.Minute
+)
+
+// Store auto-generates (or loads) a root CA and mints/caches leaf
+// certificates by SNI in an LRU with TTL, coalescing concurrent requests
+// for the same host.
+type Store struct {
+	rootCert *x509.Certificate
+	rootKey  crypto.Signer
+	rootTLS  tls.Certificate
+	rootPEM  []byte
+
+	leafKeyType KeyType
+	rootKeyType KeyType
+	maxEntries  int
+
+	mu    sync.Mutex
+	cache map[string]*list.Element // domain -> element of lru, holding *cacheEntry
+	lru   *list.List               // most-recently-used at the front
+	group singleflight.Group
+}
+
+type cacheEntry struct {
+	domain    string
+	cert      tls.Certificate
+	expiresAt time.Time
+}
+
+// Option configures a Store created with New.
+type Option func(*Store)
+
+// WithLeafKeyType overrides the key algorithm used for leaf certificates.
+func WithLeafKeyType(t KeyType) Option {
+	return func(s *Store) { s.leafKeyType = t }
+}
+
+// WithRootKeyType overrides the key algorithm used when a root CA is
+// auto-generated. It has no effect if a root CA already exists on disk,
+// since its key type was fixed at generation time.
+func WithRootKeyType(t KeyType) Option {
+	return func(s *Store) { s.rootKeyType = t }
+}
+
+// WithCacheSize overrides the maximum number of cached leaf certificates.
+func WithCacheSize(n int) Option {
+	return func(s *Store) { s.maxEntries = n }
+}
+
+// New loads the root CA from dir, generating one (2048-bit RSA by default,
+// see WithRootKeyType) if it doesn't exist yet, and returns a ready-to-use
+// Store.
+func New(dir string, opts ...Option) (*Store, error) {
+	s := &Store{
+		leafKeyType: ECDSAP256,
+		rootKeyType: RSA2048,
+		maxEntries:  defaultCacheSize,
+		cache:       make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := s.loadOrCreateRootCA(dir); err != nil {
+		return nil, fmt.Errorf("certstore: root CA: %w", err)
+	}
+
+	return s, nil
+}
+
+// CACertPEM returns the PEM-encoded root CA certificate, for serving at an
+// admin endpoint so clients can install it in their trust store.
+func (s *Store) CACertPEM() []byte {
+	return s.rootPEM
+}
+
+// GetCertificate returns a leaf certificate for domain, signed by the root
+// CA, serving it from cache when possible. Concurrent callers for the same
+// domain share a single signing operation.
+func (s *Store) GetCertificate(domain string) (tls.Certificate, error) {
+	clean := cleanDomain(domain)
+
+	if cert, ok := s.lookup(clean); ok {
+		metrics.CertCacheResults.WithLabelValues("hit").Inc()
+		return cert, nil
+	}
+	metrics.CertCacheResults.WithLabelValues("miss").Inc()
+
+	v, err, _ := s.group.Do(clean, func() (interface{}, error) {
+		if cert, ok := s.lookup(clean); ok {
+			return cert, nil
+		}
+		return s.signLeaf(clean)
+	})
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return v.(tls.Certificate), nil
+}
+
+func (s *Store) lookup(domain string) (tls.Certificate, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.cache[domain]
+	if !ok {
+		return tls.Certificate{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		return tls.Certificate{}, false
+	}
+
+	s.lru.MoveToFront(elem)
+	return entry.cert, true
+}
+
+func (s *Store) store(domain string, cert tls.Certificate, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.cache[domain]; ok {
+		elem.Value.(*cacheEntry).cert = cert
+		elem.Value.(*cacheEntry).expiresAt = expiresAt
+		s.lru.MoveToFront(elem)
+		return
+	}
+
+	if len(s.cache) >= s.maxEntries {
+		if oldest := s.lru.Back(); oldest != nil {
+			s.lru.Remove(oldest)
+			delete(s.cache, oldest.Value.(*cacheEntry).domain)
+		}
+	}
+
+	entry := &cacheEntry{domain: domain, cert: cert, expiresAt: expiresAt}
+	s.cache[domain] = s.lru.PushFront(entry)
+}
+
+func cleanDomain(domain string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(domain, ":")[0]))
+}
+
+func (s *Store) signLeaf(domain string) (tls.Certificate, error) {
+	notBefore := time.Now().Add(-5 * time.Minute)
+	notAfter := time.Now().Add(2 * time.Hour)
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: domain,
+		},
+		DNSNames:              []string{domain, "*." + domain},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	leafKey, pub, err := s.generateLeafKey()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	signed, err := x509.CreateCertificate(rand.Reader, &template, s.rootCert, pub, s.rootKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert := tls.Certificate{
+		Certificate: [][]byte{signed, s.rootTLS.Certificate[0]},
+		PrivateKey:  leafKey,
+	}
+
+	s.store(domain, cert, notAfter.Add(-expireEarly))
+	return cert, nil
+}
+
+func (s *Store) generateLeafKey() (crypto.Signer, crypto.PublicKey, error) {
+	return generateKey(s.leafKeyType)
+}
+
+// generateKey creates a new private key of the given type, returning it
+// both as a crypto.Signer and as its public key (the latter is what
+// x509.CreateCertificate wants alongside the signer).
+func generateKey(t KeyType) (crypto.Signer, crypto.PublicKey, error) {
+	switch t {
+	case RSA2048:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		return key, &key.PublicKey, err
+	case RSA4096:
+		key, err := rsa.GenerateKey(rand.Reader, 4096)
+		return key, &key.PublicKey, err
+	default:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		return key, &key.PublicKey, err
+	}
+}
+
+// marshalPrivateKeyPEM encodes key as a PEM block in the format matching its
+// algorithm (PKCS#1 for RSA, SEC 1 for ECDSA).
+func marshalPrivateKeyPEM(key crypto.Signer) (*pem.Block, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+	default:
+		return nil, fmt.Errorf("certstore: unsupported private key type %T", key)
+	}
+}
+
+func (s *Store) loadOrCreateRootCA(dir string) error {
+	certPath := filepath.Join(dir, rootCertFile)
+	keyPath := filepath.Join(dir, rootKeyFile)
+
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		if err := generateRootCA(dir, certPath, keyPath, s.rootKeyType); err != nil {
+			return err
+		}
+	}
+
+	rootTLS, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return fmt.Errorf("loading root CA: %w", err)
+	}
+
+	rootCert, err := x509.ParseCertificate(rootTLS.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parsing root CA certificate: %w", err)
+	}
+
+	signer, ok := rootTLS.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("root CA key does not implement crypto.Signer")
+	}
+
+	pemBytes, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("reading root CA PEM: %w", err)
+	}
+
+	s.rootTLS = rootTLS
+	s.rootCert = rootCert
+	s.rootKey = signer
+	s.rootPEM = pemBytes
+	return nil
+}
+
+func generateRootCA(dir, certPath, keyPath string, keyType KeyType) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating certs directory: %w", err)
+	}
+
+	key, pub, err := generateKey(keyType)
+	if err != nil {
+		return fmt.Errorf("generating root CA key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "gyxy root CA",
+			Organization: []string{"gyxy"},
+		},
+		NotBefore:             time.Now().Add(-5 * time.Minute),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, pub, key)
+	if err != nil {
+		return fmt.Errorf("signing root CA: %w", err)
+	}
+
+	certOut, err := os.Create(certPath)
+	if err != nil {
+		return err
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return err
+	}
+
+	keyBlock, err := marshalPrivateKeyPEM(key)
+	if err != nil {
+		return fmt.Errorf("encoding root CA key: %w", err)
+	}
+
+	keyOut, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer keyOut.Close()
+
+	return pem.Encode(keyOut, keyBlock)
+}
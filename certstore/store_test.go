@@ -0,0 +1,173 @@
+package certstore
+
+import (
+	"crypto/tls"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T, opts ...Option) *Store {
+	t.Helper()
+	opts = append([]Option{WithLeafKeyType(ECDSAP256), WithRootKeyType(ECDSAP256)}, opts...)
+	s, err := New(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+func TestParseKeyType(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    KeyType
+		wantErr bool
+	}{
+		{"ecdsa-p256", ECDSAP256, false},
+		{"rsa2048", RSA2048, false},
+		{"rsa4096", RSA4096, false},
+		{"bogus", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseKeyType(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeyType(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ParseKeyType(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreLookupMiss(t *testing.T) {
+	s := newTestStore(t)
+	if _, ok := s.lookup("example.com"); ok {
+		t.Error("lookup on empty store: got ok=true, want false")
+	}
+}
+
+func TestStoreLookupExpired(t *testing.T) {
+	s := newTestStore(t)
+	cert := tls.Certificate{Certificate: [][]byte{{1, 2, 3}}}
+
+	s.store("example.com", cert, time.Now().Add(-time.Minute))
+	if _, ok := s.lookup("example.com"); ok {
+		t.Error("lookup of expired entry: got ok=true, want false")
+	}
+}
+
+func TestStoreLookupHitRefreshesRecency(t *testing.T) {
+	s := newTestStore(t, WithCacheSize(2))
+	cert := tls.Certificate{Certificate: [][]byte{{1}}}
+	future := time.Now().Add(time.Hour)
+
+	s.store("a.example.com", cert, future)
+	s.store("b.example.com", cert, future)
+
+	// Touch a so it becomes most-recently-used, then add a third entry:
+	// b (now least recently used) should be evicted, not a.
+	if _, ok := s.lookup("a.example.com"); !ok {
+		t.Fatal("lookup(a): expected hit")
+	}
+	s.store("c.example.com", cert, future)
+
+	if _, ok := s.lookup("a.example.com"); !ok {
+		t.Error("lookup(a) after eviction: expected hit, a was recently used")
+	}
+	if _, ok := s.lookup("b.example.com"); ok {
+		t.Error("lookup(b) after eviction: expected miss, b was least recently used")
+	}
+	if _, ok := s.lookup("c.example.com"); !ok {
+		t.Error("lookup(c) after eviction: expected hit")
+	}
+}
+
+func TestStoreEvictsOldestWhenFull(t *testing.T) {
+	s := newTestStore(t, WithCacheSize(1))
+	cert := tls.Certificate{Certificate: [][]byte{{1}}}
+	future := time.Now().Add(time.Hour)
+
+	s.store("first.example.com", cert, future)
+	s.store("second.example.com", cert, future)
+
+	if _, ok := s.lookup("first.example.com"); ok {
+		t.Error("lookup(first) after overflow: expected miss, cache size is 1")
+	}
+	if _, ok := s.lookup("second.example.com"); !ok {
+		t.Error("lookup(second) after overflow: expected hit")
+	}
+	if len(s.cache) != 1 {
+		t.Errorf("len(s.cache) = %d, want 1", len(s.cache))
+	}
+}
+
+func TestCleanDomain(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Example.com", "example.com"},
+		{"example.com:443", "example.com"},
+		{"  example.com  ", "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := cleanDomain(tt.in); got != tt.want {
+				t.Errorf("cleanDomain(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCertificateCachesAndCoalesces(t *testing.T) {
+	s := newTestStore(t)
+
+	const n = 10
+	var wg sync.WaitGroup
+	certs := make([]tls.Certificate, n)
+	errs := make([]error, n)
+
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			certs[i], errs[i] = s.GetCertificate("concurrent.example.com")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("GetCertificate call %d: %v", i, err)
+		}
+	}
+	for i := 1; i < n; i++ {
+		if string(certs[i].Certificate[0]) != string(certs[0].Certificate[0]) {
+			t.Errorf("GetCertificate call %d returned a different leaf than call 0, want the singleflight-coalesced result", i)
+		}
+	}
+
+	if _, ok := s.lookup("concurrent.example.com"); !ok {
+		t.Error("GetCertificate: result was not cached")
+	}
+}
+
+func TestGetCertificateDifferentDomainsDontCollide(t *testing.T) {
+	s := newTestStore(t)
+
+	certA, err := s.GetCertificate("a.example.com")
+	if err != nil {
+		t.Fatalf("GetCertificate(a): %v", err)
+	}
+	certB, err := s.GetCertificate("b.example.com")
+	if err != nil {
+		t.Fatalf("GetCertificate(b): %v", err)
+	}
+
+	if string(certA.Certificate[0]) == string(certB.Certificate[0]) {
+		t.Error("GetCertificate returned identical leaves for distinct domains")
+	}
+}
@@ -0,0 +1,97 @@
+package forwarder
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// dialViaUpstream connects to target through upstream, which may be an
+// http(s):// parent proxy (issuing a nested CONNECT) or a socks5:// proxy.
+func dialViaUpstream(network, target string, upstream *url.URL) (net.Conn, error) {
+	if upstream == nil {
+		return net.Dial(network, target)
+	}
+
+	switch upstream.Scheme {
+	case "http", "https":
+		return dialHTTPConnect(network, target, upstream)
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(upstream, proxy.Direct)
+		if err != nil {
+			return nil, fmt.Errorf("forwarder: building socks5 dialer for %q: %w", upstream, err)
+		}
+		return dialer.Dial(network, target)
+	default:
+		return nil, fmt.Errorf("forwarder: unsupported upstream scheme %q", upstream.Scheme)
+	}
+}
+
+// dialHTTPConnect opens target by issuing a CONNECT request over a TCP (or,
+// for an https:// upstream, TLS) connection to the parent HTTP(S) proxy.
+func dialHTTPConnect(network, target string, upstream *url.URL) (net.Conn, error) {
+	conn, err := DialUpstreamTransport(network, upstream)
+	if err != nil {
+		return nil, fmt.Errorf("forwarder: dialing upstream %q: %w", upstream.Host, err)
+	}
+
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
+	if upstream.User != nil {
+		req += fmt.Sprintf("Proxy-Authorization: Basic %s\r\n", BasicAuthToken(upstream.User))
+	}
+	req += "\r\n"
+
+	if _, err := conn.Write([]byte(req)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("forwarder: writing CONNECT to upstream: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("forwarder: reading CONNECT response: %w", err)
+	}
+
+	var proto string
+	var status int
+	if _, err := fmt.Sscanf(resp, "HTTP/%s %d", &proto, &status); err != nil || status != 200 {
+		conn.Close()
+		return nil, fmt.Errorf("forwarder: upstream refused CONNECT: %q", resp)
+	}
+
+	// Drain the remaining response headers before handing the connection off.
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil || line == "\r\n" {
+			break
+		}
+	}
+
+	return conn, nil
+}
+
+// DialUpstreamTransport opens the TCP (or TLS, for an https:// upstream)
+// connection a CONNECT/absolute-form request to upstream is written over.
+func DialUpstreamTransport(network string, upstream *url.URL) (net.Conn, error) {
+	if upstream.Scheme == "https" {
+		host, _, err := net.SplitHostPort(upstream.Host)
+		if err != nil {
+			host = upstream.Host
+		}
+		return tls.Dial(network, upstream.Host, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	}
+	return net.Dial(network, upstream.Host)
+}
+
+// BasicAuthToken encodes user as the base64 token of a "Basic"
+// Proxy-Authorization/Authorization header value.
+func BasicAuthToken(user *url.Userinfo) string {
+	pass, _ := user.Password()
+	return base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + pass))
+}
@@ -0,0 +1,186 @@
+// Package forwarder lets gyxy send outbound traffic through a parent
+// HTTP/HTTPS/SOCKS5 proxy instead of dialing origins directly, with
+// per-request routing decided by a small rule set.
+package forwarder
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decision is the routing verdict for a destination host.
+type Decision int
+
+const (
+	// Direct dials the origin directly, bypassing any upstream proxy.
+	Direct Decision = iota
+	// ViaProxy dials through the parent proxy configured for the rule
+	// (or the default upstream if the rule didn't specify one).
+	ViaProxy
+	// Block refuses the connection outright.
+	Block
+	// Tunnel splices bytes through the upstream without MITM-ing TLS.
+	Tunnel
+)
+
+// reloadInterval is how often the rules file is re-read from disk.
+const reloadInterval = 30 * time.Second
+
+// Forwarder dials outbound connections, routing each one through a parent
+// proxy (or direct) according to the loaded rules.
+type Forwarder struct {
+	defaultUpstream *url.URL
+	rulesPath       string
+
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// New builds a Forwarder. upstream is the default parent proxy URL (may be
+// empty to mean "direct by default"); rulesPath is an optional YAML/JSON
+// file of per-host routing rules, reloaded periodically.
+func New(upstream string, rulesPath string) (*Forwarder, error) {
+	f := &Forwarder{rulesPath: rulesPath}
+
+	if upstream != "" {
+		u, err := url.Parse(upstream)
+		if err != nil {
+			return nil, fmt.Errorf("forwarder: invalid upstream URL %q: %w", upstream, err)
+		}
+		f.defaultUpstream = u
+	}
+
+	if rulesPath != "" {
+		if err := f.reload(); err != nil {
+			return nil, fmt.Errorf("forwarder: loading rules %q: %w", rulesPath, err)
+		}
+		go f.reloadLoop()
+	}
+
+	return f, nil
+}
+
+// FromEnvironment builds a Forwarder from HTTP_PROXY/HTTPS_PROXY/NO_PROXY,
+// mirroring the bootstrap behaviour of http.ProxyFromEnvironment. It
+// returns nil, nil if no proxy env vars are set.
+func FromEnvironment() (*Forwarder, error) {
+	upstream := firstNonEmpty(os.Getenv("HTTPS_PROXY"), os.Getenv("https_proxy"),
+		os.Getenv("HTTP_PROXY"), os.Getenv("http_proxy"))
+	if upstream == "" {
+		return nil, nil
+	}
+
+	f, err := New(upstream, "")
+	if err != nil {
+		return nil, err
+	}
+
+	noProxy := firstNonEmpty(os.Getenv("NO_PROXY"), os.Getenv("no_proxy"))
+	for _, host := range strings.Split(noProxy, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		f.rules = append(f.rules, Rule{Pattern: noProxyPattern(host), Decision: Direct})
+	}
+
+	return f, nil
+}
+
+// noProxyPattern turns a single NO_PROXY entry into a Rule.Pattern. Per the
+// conventional NO_PROXY semantics (as in golang.org/x/net/http/httpproxy), a
+// bare "corp.internal" or leading-dot ".corp.internal" entry bypasses the
+// proxy for that host AND all of its subdomains, not just an exact match.
+func noProxyPattern(host string) string {
+	if strings.HasPrefix(host, "*.") {
+		return host
+	}
+	return "*." + strings.TrimPrefix(host, ".")
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (f *Forwarder) reloadLoop() {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Best effort: keep serving the last-known-good rule set on error.
+		_ = f.reload()
+	}
+}
+
+func (f *Forwarder) reload() error {
+	rules, err := loadRules(f.rulesPath)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.rules = rules
+	f.mu.Unlock()
+	return nil
+}
+
+// Route evaluates the configured rules against host (and its resolved IP,
+// if known) in order, returning the first match. If no rule matches, it
+// falls back to ViaProxy when a default upstream is configured, or Direct
+// otherwise.
+func (f *Forwarder) Route(host string, ip net.IP) (Decision, *url.URL) {
+	f.mu.RLock()
+	rules := f.rules
+	f.mu.RUnlock()
+
+	for _, rule := range rules {
+		if rule.Matches(host, ip) {
+			if rule.Upstream != nil {
+				return rule.Decision, rule.Upstream
+			}
+			return rule.Decision, f.defaultUpstream
+		}
+	}
+
+	if f.defaultUpstream != nil {
+		return ViaProxy, f.defaultUpstream
+	}
+	return Direct, nil
+}
+
+// Dial opens a connection to target ("host:port"), routing through the
+// parent proxy selected by Route, or dialing directly.
+func (f *Forwarder) Dial(network, target string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, fmt.Errorf("forwarder: invalid target %q: %w", target, err)
+	}
+
+	ips, _ := net.LookupIP(host)
+	var ip net.IP
+	if len(ips) > 0 {
+		ip = ips[0]
+	}
+
+	decision, upstream := f.Route(host, ip)
+	switch decision {
+	case Block:
+		return nil, fmt.Errorf("forwarder: host %q blocked by routing rule", host)
+	case Direct:
+		return net.Dial(network, target)
+	case ViaProxy, Tunnel:
+		return dialViaUpstream(network, target, upstream)
+	default:
+		return net.Dial(network, target)
+	}
+}
@@ -0,0 +1,83 @@
+package forwarder
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule is one entry of the routing policy: if Pattern (a host glob) or CIDR
+// matches the destination, Decision (and optionally a rule-specific
+// Upstream) applies.
+type Rule struct {
+	Pattern  string     `yaml:"pattern" json:"pattern"`
+	CIDR     string     `yaml:"cidr" json:"cidr"`
+	Verb     string     `yaml:"verb" json:"verb"` // DIRECT, PROXY, BLOCK, TUNNEL
+	Proxy    string     `yaml:"proxy" json:"proxy"`
+	Decision Decision   `yaml:"-" json:"-"`
+	Upstream *url.URL   `yaml:"-" json:"-"`
+	ipNet    *net.IPNet `yaml:"-" json:"-"`
+}
+
+// Matches reports whether host (or its resolved ip, if non-nil) satisfies
+// the rule's pattern or CIDR. When the rule has a CIDR and ip is non-nil,
+// only the CIDR is consulted; otherwise host is matched against Pattern.
+func (r Rule) Matches(host string, ip net.IP) bool {
+	if r.ipNet != nil && ip != nil {
+		return r.ipNet.Contains(ip)
+	}
+
+	if r.Pattern == "" {
+		return false
+	}
+
+	if strings.HasPrefix(r.Pattern, "*.") {
+		return strings.EqualFold(host, r.Pattern[2:]) || strings.HasSuffix(strings.ToLower(host), strings.ToLower(r.Pattern[1:]))
+	}
+
+	return strings.EqualFold(host, r.Pattern)
+}
+
+// loadRules reads a YAML or JSON rules file (based on DIRECT/PROXY/BLOCK/
+// TUNNEL verbs) and resolves each rule's CIDR and proxy URL.
+func loadRules(path string) ([]Rule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := yaml.Unmarshal(raw, &rules); err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		switch strings.ToUpper(rules[i].Verb) {
+		case "BLOCK":
+			rules[i].Decision = Block
+		case "TUNNEL":
+			rules[i].Decision = Tunnel
+		case "PROXY":
+			rules[i].Decision = ViaProxy
+		case "DIRECT", "":
+			rules[i].Decision = Direct
+		}
+
+		if rules[i].CIDR != "" {
+			if _, ipNet, err := net.ParseCIDR(rules[i].CIDR); err == nil {
+				rules[i].ipNet = ipNet
+			}
+		}
+
+		if rules[i].Proxy != "" {
+			if u, err := url.Parse(rules[i].Proxy); err == nil {
+				rules[i].Upstream = u
+			}
+		}
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,126 @@
+package forwarder
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestRuleMatches(t *testing.T) {
+	cidrRule := Rule{CIDR: "10.0.0.0/8"}
+	loadRulesCIDR(t, &cidrRule)
+
+	tests := []struct {
+		name string
+		rule Rule
+		host string
+		ip   net.IP
+		want bool
+	}{
+		{"exact host match", Rule{Pattern: "example.com"}, "example.com", nil, true},
+		{"exact host case-insensitive", Rule{Pattern: "Example.COM"}, "example.com", nil, true},
+		{"exact host mismatch", Rule{Pattern: "example.com"}, "other.com", nil, false},
+		{"wildcard matches subdomain", Rule{Pattern: "*.example.com"}, "sub.example.com", nil, true},
+		{"wildcard matches bare domain", Rule{Pattern: "*.example.com"}, "example.com", nil, true},
+		{"wildcard does not match unrelated suffix", Rule{Pattern: "*.example.com"}, "notexample.com", nil, false},
+		{"empty pattern never matches", Rule{}, "example.com", nil, false},
+		{"cidr contains ip", cidrRule, "whatever.internal", net.ParseIP("10.1.2.3"), true},
+		{"cidr excludes ip", cidrRule, "whatever.internal", net.ParseIP("192.168.1.1"), false},
+		{"cidr with nil ip falls back to pattern", cidrRule, "whatever.internal", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.host, tt.ip); got != tt.want {
+				t.Errorf("Matches(%q, %v) = %v, want %v", tt.host, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+// loadRulesCIDR resolves r.ipNet the same way loadRules does, since ipNet
+// is unexported and rule fixtures built outside loadRules wouldn't
+// otherwise get it populated.
+func loadRulesCIDR(t *testing.T, r *Rule) {
+	t.Helper()
+	_, ipNet, err := net.ParseCIDR(r.CIDR)
+	if err != nil {
+		t.Fatalf("ParseCIDR(%q): %v", r.CIDR, err)
+	}
+	r.ipNet = ipNet
+}
+
+func TestNoProxyPattern(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{"bare host", "corp.internal", "*.corp.internal"},
+		{"leading dot", ".corp.internal", "*.corp.internal"},
+		{"already a wildcard", "*.corp.internal", "*.corp.internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := noProxyPattern(tt.host); got != tt.want {
+				t.Errorf("noProxyPattern(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("url.Parse(%q): %v", raw, err)
+	}
+	return u
+}
+
+func TestForwarderRoute(t *testing.T) {
+	upstream := mustParseURL(t, "http://proxy.internal:3128")
+	ruleUpstream := mustParseURL(t, "http://other-proxy.internal:3128")
+
+	f := &Forwarder{
+		defaultUpstream: upstream,
+		rules: []Rule{
+			{Pattern: "blocked.example.com", Decision: Block},
+			{Pattern: "*.direct.example.com", Decision: Direct},
+			{Pattern: "*.other-proxy.example.com", Decision: ViaProxy, Upstream: ruleUpstream},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		host         string
+		wantDecision Decision
+		wantUpstream *url.URL
+	}{
+		{"blocked host", "blocked.example.com", Block, upstream},
+		{"direct rule bypasses default upstream", "sub.direct.example.com", Direct, upstream},
+		{"rule with its own upstream wins over default", "sub.other-proxy.example.com", ViaProxy, ruleUpstream},
+		{"unmatched host falls back to default upstream", "unmatched.example.com", ViaProxy, upstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, gotUpstream := f.Route(tt.host, nil)
+			if decision != tt.wantDecision {
+				t.Errorf("Route(%q) decision = %v, want %v", tt.host, decision, tt.wantDecision)
+			}
+			if tt.wantDecision != Direct && gotUpstream != tt.wantUpstream {
+				t.Errorf("Route(%q) upstream = %v, want %v", tt.host, gotUpstream, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestForwarderRouteNoDefaultUpstream(t *testing.T) {
+	f := &Forwarder{}
+	decision, upstream := f.Route("anything.example.com", nil)
+	if decision != Direct || upstream != nil {
+		t.Errorf("Route() = (%v, %v), want (Direct, nil)", decision, upstream)
+	}
+}
@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 
+	"github.com/mohamedbeat/gyxy/acl"
+	"github.com/mohamedbeat/gyxy/admin"
+	"github.com/mohamedbeat/gyxy/auth"
+	"github.com/mohamedbeat/gyxy/certstore"
+	"github.com/mohamedbeat/gyxy/forwarder"
 	"github.com/mohamedbeat/gyxy/logger"
 	"github.com/mohamedbeat/gyxy/proxy"
 	"go.uber.org/zap"
 )
 
 func main() {
+	authParam := flag.String("auth", "none://", "authentication scheme URI (static://user:pass@/, basicfile:///path, none://)")
+	upstream := flag.String("upstream", "", "parent proxy URL to chain outbound traffic through (http://, https://, socks5://)")
+	routes := flag.String("routes", "", "path to a YAML/JSON routing rules file (DIRECT/PROXY/BLOCK/TUNNEL per host)")
+	certsDir := flag.String("certs-dir", "certs", "directory holding (or to generate) the root CA and leaf cert cache")
+	caKeyType := flag.String("ca-key-type", "rsa2048", "key algorithm for an auto-generated root CA (ecdsa-p256, rsa2048, rsa4096); ignored if a root CA already exists on disk")
+	leafKeyType := flag.String("leaf-key-type", "ecdsa-p256", "key algorithm for minted leaf certificates (ecdsa-p256, rsa2048, rsa4096)")
+	aclPath := flag.String("acl", "blocked", "path to the ACL rules file (allow/deny, hot-reloaded)")
+	adminAddr := flag.String("admin-addr", "127.0.0.1:9090", "address for the admin HTTP server (ca.pem, metrics, pprof, ACL rules); binds loopback-only by default since /gyxy/acl/rules and /debug/pprof/* are sensitive")
+	flag.Parse()
+
 	// Initialize logger
 	logg, err := logger.InitLogger()
 	if err != nil {
@@ -16,9 +33,63 @@ func main() {
 	}
 	defer logg.Sync()
 
+	a, err := auth.NewAuth(*authParam)
+	if err != nil {
+		logg.Fatal("Error configuring auth", zap.Error(err))
+	}
+
+	fwd, err := newForwarder(*upstream, *routes)
+	if err != nil {
+		logg.Fatal("Error configuring upstream forwarder", zap.Error(err))
+	}
+
+	rootKeyType, err := certstore.ParseKeyType(*caKeyType)
+	if err != nil {
+		logg.Fatal("Invalid --ca-key-type", zap.Error(err))
+	}
+	leafKeyTypeVal, err := certstore.ParseKeyType(*leafKeyType)
+	if err != nil {
+		logg.Fatal("Invalid --leaf-key-type", zap.Error(err))
+	}
+
+	cs, err := certstore.New(*certsDir, certstore.WithRootKeyType(rootKeyType), certstore.WithLeafKeyType(leafKeyTypeVal))
+	if err != nil {
+		logg.Fatal("Error configuring cert store", zap.Error(err))
+	}
+
+	engine, err := acl.New(*aclPath, logg)
+	if err != nil {
+		logg.Fatal("Error configuring ACL engine", zap.Error(err))
+	}
+
+	adminSrv := admin.New(*adminAddr, logg)
+	adminSrv.Handle("/gyxy/ca.pem", admin.CAHandler(cs.CACertPEM))
+	adminSrv.Handle("/gyxy/acl/rules", admin.RequireAuth(a, acl.RulesHandler(engine)))
+	adminSrv.RegisterDebug(a)
+	go func() {
+		if err := adminSrv.Start(context.Background()); err != nil {
+			logg.Error("Admin server failed", zap.Error(err))
+		}
+	}()
+
+	opts := []proxy.Option{proxy.WithAuth(a), proxy.WithCertStore(cs), proxy.WithACL(engine)}
+	if fwd != nil {
+		opts = append(opts, proxy.WithUpstream(fwd))
+	}
+
 	// Create and start proxy
-	proxy := proxy.New(logg)
+	proxy := proxy.New(logg, opts...)
 	if err := proxy.Start(":8080"); err != nil {
 		logg.Fatal("Proxy server failed", zap.Error(err))
 	}
 }
+
+// newForwarder builds the outbound forwarder from explicit CLI flags if
+// given, falling back to HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment
+// variables.
+func newForwarder(upstream, routes string) (*forwarder.Forwarder, error) {
+	if upstream != "" || routes != "" {
+		return forwarder.New(upstream, routes)
+	}
+	return forwarder.FromEnvironment()
+}
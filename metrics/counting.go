@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countingReader wraps an io.Reader, adding every byte read to counter.
+type countingReader struct {
+	io.Reader
+	counter prometheus.Counter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.counter.Add(float64(n))
+	}
+	return n, err
+}
+
+// CountReader returns an io.Reader that adds every byte read from r to
+// counter.
+func CountReader(r io.Reader, counter prometheus.Counter) io.Reader {
+	return &countingReader{Reader: r, counter: counter}
+}
+
+// countingWriter wraps an io.Writer, adding every byte written to counter.
+type countingWriter struct {
+	io.Writer
+	counter prometheus.Counter
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if n > 0 {
+		w.counter.Add(float64(n))
+	}
+	return n, err
+}
+
+// CountWriter returns an io.Writer that adds every byte written to w to
+// counter.
+func CountWriter(w io.Writer, counter prometheus.Counter) io.Writer {
+	return &countingWriter{Writer: w, counter: counter}
+}
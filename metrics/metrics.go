@@ -0,0 +1,77 @@
+// Package metrics registers gyxy's Prometheus collectors and provides
+// small io.Reader/io.Writer wrappers for counting bytes in the proxy's
+// copy loops.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	// ConnectionsAccepted counts inbound connections accepted by the
+	// proxy listener.
+	ConnectionsAccepted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gyxy",
+		Name:      "connections_accepted_total",
+		Help:      "Total number of inbound connections accepted.",
+	})
+
+	// ActiveTunnels tracks the number of currently open CONNECT tunnels
+	// and protocol-upgraded (e.g. WebSocket) connections.
+	ActiveTunnels = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gyxy",
+		Name:      "active_tunnels",
+		Help:      "Number of currently open CONNECT tunnels and upgraded connections.",
+	})
+
+	// BytesTransferred counts bytes copied between client and server,
+	// labeled by direction ("in" client->server, "out" server->client).
+	BytesTransferred = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gyxy",
+		Name:      "bytes_transferred_total",
+		Help:      "Total bytes copied between client and server.",
+	}, []string{"direction"})
+
+	// TLSHandshakeDuration measures how long the client-facing MITM TLS
+	// handshake takes.
+	TLSHandshakeDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gyxy",
+		Name:      "tls_handshake_duration_seconds",
+		Help:      "Duration of the client-facing MITM TLS handshake.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// CertCacheResults counts certstore cache hits vs. misses, labeled by
+	// "result" ("hit" or "miss").
+	CertCacheResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gyxy",
+		Name:      "cert_cache_results_total",
+		Help:      "Leaf certificate cache hits and misses.",
+	}, []string{"result"})
+
+	// UpstreamDialErrors counts failures dialing the origin or parent
+	// proxy.
+	UpstreamDialErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gyxy",
+		Name:      "upstream_dial_errors_total",
+		Help:      "Total errors dialing an upstream origin or parent proxy.",
+	})
+
+	// HTTPResponses counts forwarded HTTP responses, labeled by status
+	// code.
+	HTTPResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gyxy",
+		Name:      "http_responses_total",
+		Help:      "Total HTTP responses forwarded, by status code.",
+	}, []string{"status"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		ConnectionsAccepted,
+		ActiveTunnels,
+		BytesTransferred,
+		TLSHandshakeDuration,
+		CertCacheResults,
+		UpstreamDialErrors,
+		HTTPResponses,
+	)
+}
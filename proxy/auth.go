@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+
+	"go.uber.org/zap"
+
+	"github.com/mohamedbeat/gyxy/auth"
+)
+
+// checkProxyAuth validates proxyAuth (the Proxy-Authorization header value,
+// if any) against p.Auth. If auth is disabled it always succeeds. On
+// failure it writes a 407 Proxy Authentication Required response and
+// returns false.
+func (p *Proxy) checkProxyAuth(client net.Conn, proxyAuth string) bool {
+	if p.Auth == nil {
+		return true
+	}
+
+	user, ok := p.Auth.Validate(auth.Request{
+		Header:     proxyAuth,
+		RemoteAddr: client.RemoteAddr().String(),
+	})
+	if !ok {
+		p.Logger.Warn("Proxy authentication failed",
+			zap.String("client", client.RemoteAddr().String()))
+		p.sendProxyAuthRequired(client)
+		return false
+	}
+
+	p.Logger.Debug("Proxy authentication succeeded",
+		zap.String("user", user),
+		zap.String("client", client.RemoteAddr().String()))
+	return true
+}
+
+// sendProxyAuthRequired writes a 407 response asking the client to
+// authenticate via HTTP Basic auth.
+func (p *Proxy) sendProxyAuthRequired(client net.Conn) {
+	const body = "Proxy Authentication Required"
+	response := fmt.Sprintf("HTTP/1.1 407 Proxy Authentication Required\r\n"+
+		"Proxy-Authenticate: Basic realm=\"gyxy\"\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Length: %d\r\n"+
+		"Connection: close\r\n"+
+		"\r\n%s", len(body), body)
+
+	if _, err := client.Write([]byte(response)); err != nil {
+		p.Logger.Error("Failed to send 407 response", zap.Error(err))
+	}
+}
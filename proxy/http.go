@@ -5,124 +5,272 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"go.uber.org/zap"
+
+	"github.com/mohamedbeat/gyxy/forwarder"
+	"github.com/mohamedbeat/gyxy/metrics"
 )
 
+// hopByHopHeaders are stripped before forwarding a request or response, per
+// RFC 7230 §6.1 (plus the legacy Proxy-Connection).
+var hopByHopHeaders = []string{
+	"Proxy-Connection",
+	"Proxy-Authorization",
+	"Connection",
+	"Keep-Alive",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// stripHopByHopHeaders deletes hopByHopHeaders from h, unless preserveUpgrade
+// is set, in which case Connection and Upgrade are left alone so a protocol
+// upgrade (e.g. WebSocket) can be negotiated end-to-end.
+func stripHopByHopHeaders(h http.Header, preserveUpgrade bool) {
+	for _, name := range hopByHopHeaders {
+		if preserveUpgrade && (name == "Connection" || name == "Upgrade") {
+			continue
+		}
+		h.Del(name)
+	}
+}
+
+// isUpgradeRequest reports whether req is asking to switch protocols, e.g.
+// "Connection: Upgrade" + "Upgrade: websocket". The check is generic so any
+// upgrade token (websocket, h2c, ...) is handled the same way.
+func isUpgradeRequest(req *http.Request) bool {
+	return req.Header.Get("Upgrade") != "" && headerContainsToken(req.Header.Get("Connection"), "upgrade")
+}
+
+func headerContainsToken(header, token string) bool {
+	for _, v := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleHTTP serves a plain-HTTP client connection, looping to honor
+// Connection: keep-alive so a browser can pipeline multiple requests over
+// one TCP connection instead of paying a new dial per request.
 func (p *Proxy) handleHTTP(client net.Conn, reader *bufio.Reader) {
 	defer client.Close()
-	client.SetDeadline(time.Now().Add(30 * time.Second))
 
-	req, err := p.parseRequest(reader)
-	if err != nil {
-		p.Logger.Error("Error parsing HTTP request", zap.Error(err))
-		return
-	}
-	if shouldBlock := p.checkAndBlockHost(client, req.Host); shouldBlock {
-		return
+	for {
+		client.SetDeadline(time.Now().Add(30 * time.Second))
+
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			if err != io.EOF {
+				p.Logger.Debug("Error reading HTTP request", zap.Error(err))
+			}
+			return
+		}
+
+		if !p.checkProxyAuth(client, req.Header.Get("Proxy-Authorization")) {
+			return
+		}
+
+		host := req.URL.Hostname()
+		if host == "" {
+			host, _, _ = net.SplitHostPort(req.Host)
+			if host == "" {
+				host = req.Host
+			}
+		}
+		if shouldBlock := p.checkAndBlockHost(client, host); shouldBlock {
+			return
+		}
+
+		p.Logger.Info("HTTP request",
+			zap.String("method", req.Method),
+			zap.String("host", host),
+			zap.String("path", req.URL.Path),
+			zap.String("clientRemoteAddr", client.RemoteAddr().String()))
+
+		keepAlive, err := p.roundTrip(client, reader, req)
+		if err != nil {
+			p.Logger.Error("Error handling HTTP request", zap.Error(err))
+			return
+		}
+		if !keepAlive {
+			return
+		}
 	}
+}
+
+// roundTrip forwards req to its origin (or a parent proxy) and streams the
+// response back to client, returning whether the connection should be kept
+// alive for a subsequent request. clientReader is the buffered reader
+// handleHTTP is reading req from; it's reused verbatim if the exchange
+// switches protocols, so no client bytes already buffered there are lost.
+func (p *Proxy) roundTrip(client net.Conn, clientReader *bufio.Reader, req *http.Request) (keepAlive bool, err error) {
+	target := requestTarget(req)
 
-	p.Logger.Info("HTTP request",
-		zap.String("method", req.Method),
-		zap.String("host", req.Host),
-		zap.String("path", req.Path),
-		zap.String("clientLocalAddr", client.LocalAddr().String()),
-		zap.String("clientRemoteAddr", client.RemoteAddr().String()))
+	requestClose := req.Close || strings.EqualFold(req.Header.Get("Connection"), "close")
+	upgradeRequested := isUpgradeRequest(req)
+	stripHopByHopHeaders(req.Header, upgradeRequested)
 
-	// Connect to target
-	target := net.JoinHostPort(req.Host, req.Port)
-	server, err := net.Dial("tcp", target)
+	// A pooled connection may have been closed by the origin in the gap
+	// since it was put back (the common case, since most origins time out
+	// keep-alive sockets well under our idleTimeout). That only costs us
+	// the one pooled attempt, so retry once against a fresh dial instead
+	// of failing the request.
+	server, pooled, absoluteForm, err := p.dialHTTPTarget(target, req, upgradeRequested)
 	if err != nil {
-		p.Logger.Error("Error connecting to target", zap.Error(err))
-		return
+		metrics.UpstreamDialErrors.Inc()
+		return false, fmt.Errorf("connecting to target: %w", err)
 	}
-	defer server.Close()
 
-	// Forward request
-	if _, err := server.Write([]byte(req.Raw)); err != nil {
-		p.Logger.Error("Error forwarding request", zap.Error(err))
-		return
-	}
+	// A request body is a one-shot reader: writeAndReadResponse already
+	// drained it on the first attempt, so a retry can only safely replay
+	// requests that never had one (the GET/HEAD case this stale-pooled-
+	// connection retry is meant for).
+	retryable := req.Body == nil || req.Body == http.NoBody
 
-	// Forward response
-	if err := p.forwardResponse(client, server); err != nil {
-		p.Logger.Error("Error forwarding response", zap.Error(err))
+	serverReader, resp, err := p.writeAndReadResponse(server, req, absoluteForm)
+	if err != nil && pooled && retryable {
+		p.Logger.Debug("pooled connection stale, retrying with a fresh dial",
+			zap.String("target", target), zap.Error(err))
+		server, _, absoluteForm, err = p.dialHTTPTarget(target, req, true)
+		if err != nil {
+			metrics.UpstreamDialErrors.Inc()
+			return false, fmt.Errorf("connecting to target: %w", err)
+		}
+		serverReader, resp, err = p.writeAndReadResponse(server, req, absoluteForm)
 	}
-}
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
 
-func (p *Proxy) parseRequest(reader *bufio.Reader) (*HTTPRequest, error) {
-	req := &HTTPRequest{Port: "80"}
-	var raw strings.Builder
+	p.Logger.Info("HTTP response",
+		zap.String("proto", resp.Proto),
+		zap.Int("status", resp.StatusCode))
+	metrics.HTTPResponses.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
 
-	// Read request line
-	firstLine, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, err
+	upgraded := upgradeRequested && resp.StatusCode == http.StatusSwitchingProtocols
+	stripHopByHopHeaders(resp.Header, upgraded)
+	if err := resp.Write(client); err != nil {
+		server.Close()
+		return false, fmt.Errorf("forwarding response: %w", err)
 	}
-	raw.WriteString(firstLine)
 
-	parts := strings.Split(strings.TrimSpace(firstLine), " ")
-	if len(parts) < 3 {
-		return nil, fmt.Errorf("malformed request line")
+	if upgraded {
+		// The exchange is no longer HTTP: drop both deadlines (a WebSocket
+		// or other upgraded connection can sit idle far longer than the
+		// 30s request deadline) and splice the raw bytes through.
+		client.SetDeadline(time.Time{})
+		server.SetDeadline(time.Time{})
+		p.spliceConn(client, clientReader, server, serverReader)
+		return false, nil
 	}
 
-	req.Method = parts[0]
-	req.Path = parts[1]
-	req.Protocol = parts[2]
+	keepAlive = !requestClose && !resp.Close
+	if keepAlive {
+		p.pool.put(target, server, absoluteForm)
+	} else {
+		server.Close()
+	}
+	return keepAlive, nil
+}
 
-	// Read headers
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, err
-		}
-		raw.WriteString(line)
+// writeAndReadResponse writes req to server (in absolute-form if
+// absoluteForm is set) and reads the response back. On any error it closes
+// server itself, since the caller has no further use for a connection that
+// failed mid-exchange.
+func (p *Proxy) writeAndReadResponse(server net.Conn, req *http.Request, absoluteForm bool) (*bufio.Reader, *http.Response, error) {
+	writeErr := writeRequest(server, req, absoluteForm)
+	if writeErr == nil {
+		writeErr = server.SetReadDeadline(time.Now().Add(30 * time.Second))
+	}
+	if writeErr != nil {
+		server.Close()
+		return nil, nil, fmt.Errorf("forwarding request: %w", writeErr)
+	}
 
-		if line == "\r\n" {
-			break
-		}
+	serverReader := bufio.NewReader(server)
+	resp, err := http.ReadResponse(serverReader, req)
+	if err != nil {
+		server.Close()
+		return nil, nil, fmt.Errorf("reading response: %w", err)
+	}
+	return serverReader, resp, nil
+}
 
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
+// requestTarget returns the "host:port" a request should be dialed to,
+// preferring an absolute request-URI but falling back to the Host header
+// that forward-proxy clients normally send with an origin-form request.
+func requestTarget(req *http.Request) string {
+	host := req.URL.Hostname()
+	port := req.URL.Port()
+	if host == "" {
+		host, port, _ = net.SplitHostPort(req.Host)
+		if host == "" {
+			host = req.Host
 		}
+	}
+	if port == "" {
+		port = "80"
+	}
+	return net.JoinHostPort(host, port)
+}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
+// writeRequest serializes req onto server, in absolute-form when forwarding
+// to a parent HTTP proxy, or origin-form when dialing the origin directly.
+func writeRequest(server net.Conn, req *http.Request, absoluteForm bool) error {
+	if absoluteForm {
+		if !req.URL.IsAbs() {
+			req.URL.Scheme = "http"
+			req.URL.Host = req.Host
+		}
+		return req.WriteProxy(server)
+	}
+	return req.Write(server)
+}
 
-		switch key {
-		case "Host":
-			hostParts := strings.Split(value, ":")
-			req.Host = hostParts[0]
-			if len(hostParts) > 1 {
-				req.Port = hostParts[1]
-			}
-		case "User-Agent":
-			req.UserAgent = value
-		case "Proxy-Connection":
-			req.ProxyConnection = value
+// dialHTTPTarget opens a connection to target: reusing a pooled idle
+// connection when available, else routing through a parent HTTP proxy
+// (absolute-form) when the forwarder's rules say so, or dialing
+// directly/via SOCKS5 otherwise. skipPool forces a fresh dial, used for
+// requests that intend to switch protocols (the resulting connection won't
+// be returned to the pool anyway) and to retry a request once a pooled
+// connection turns out to be stale.
+func (p *Proxy) dialHTTPTarget(target string, req *http.Request, skipPool bool) (conn net.Conn, pooled bool, absoluteForm bool, err error) {
+	if !skipPool {
+		if c, absForm := p.pool.get(target); c != nil {
+			return c, true, absForm, nil
 		}
 	}
 
-	req.Raw = raw.String()
-	return req, nil
-}
+	if p.Forwarder == nil {
+		conn, err = net.Dial("tcp", target)
+		return conn, false, false, err
+	}
 
-func (p *Proxy) forwardResponse(client net.Conn, server net.Conn) error {
-	resp, err := p.parseResponse(bufio.NewReader(server))
-	if err != nil {
-		return err
+	host, _, _ := net.SplitHostPort(target)
+	ips, _ := net.LookupIP(host)
+	var ip net.IP
+	if len(ips) > 0 {
+		ip = ips[0]
 	}
 
-	p.Logger.Info("HTTP response",
-		zap.String("proto", resp.Proto),
-		zap.Int("status", resp.StatusCode))
+	decision, upstream := p.Forwarder.Route(host, ip)
+	if decision == forwarder.ViaProxy && upstream != nil && (upstream.Scheme == "http" || upstream.Scheme == "https") {
+		if upstream.User != nil {
+			req.Header.Set("Proxy-Authorization", "Basic "+forwarder.BasicAuthToken(upstream.User))
+		}
+		conn, err = forwarder.DialUpstreamTransport("tcp", upstream)
+		return conn, false, true, err
+	}
 
-	_, err = client.Write(resp.RawResponse)
-	return err
+	conn, err = p.Forwarder.Dial("tcp", target)
+	return conn, false, false, err
 }
@@ -3,21 +3,19 @@ package proxy
 import (
 	"bufio"
 	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
 	"fmt"
 	"io"
-	"math/big"
 	"net"
 	"strings"
 	"sync"
-	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
+
+	"github.com/mohamedbeat/gyxy/certstore"
+	"github.com/mohamedbeat/gyxy/forwarder"
+	"github.com/mohamedbeat/gyxy/metrics"
 )
 
 const (
@@ -40,26 +38,103 @@ const (
 func (p *Proxy) handleHTTPS(client net.Conn, reader *bufio.Reader) {
 	defer client.Close()
 
-	target, domain, err := p.processConnectRequest(reader)
+	target, domain, proxyAuth, err := p.processConnectRequest(reader)
 	if err != nil {
 		p.Logger.Error("Failed to process CONNECT request", zap.Error(err))
 		return
 	}
 
+	if !p.checkProxyAuth(client, proxyAuth) {
+		return
+	}
+
 	if shouldBlock := p.checkAndBlockHost(client, domain); shouldBlock {
 		return
 	}
 
+	if p.Forwarder != nil {
+		ips, _ := net.LookupIP(domain)
+		var ip net.IP
+		if len(ips) > 0 {
+			ip = ips[0]
+		}
+
+		if decision, _ := p.Forwarder.Route(domain, ip); decision == forwarder.Tunnel {
+			if err := p.establishRawTunnel(client, target); err != nil {
+				p.Logger.Error("Raw tunneling failed", zap.Error(err))
+			}
+			return
+		}
+	}
+
 	if err := p.establishMITMTunnel(client, target, domain); err != nil {
 		p.Logger.Error("MITM tunneling failed", zap.Error(err))
 	}
 }
 
+// establishRawTunnel splices the client connection directly to target
+// without MITM-ing the TLS handshake, used for rules marked TUNNEL.
+func (p *Proxy) establishRawTunnel(client net.Conn, target string) error {
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return fmt.Errorf("failed to send 200 response: %w", err)
+	}
+
+	server, err := p.dialBackend(target)
+	if err != nil {
+		metrics.UpstreamDialErrors.Inc()
+		return fmt.Errorf("failed to connect to target: %w", err)
+	}
+
+	p.spliceConn(client, client, server, server)
+	return nil
+}
+
+// spliceConn performs a raw, protocol-agnostic bidirectional copy between
+// client and server until either side closes, tracking byte metrics. It's
+// used once a connection is past HTTP framing entirely: CONNECT tunnels, and
+// connections that have switched protocols (e.g. a WebSocket Upgrade).
+//
+// clientReader and serverReader are the readers to copy from; pass the conn
+// itself unless some of its bytes were already buffered by an earlier read
+// (e.g. the bufio.Reader used to parse the preceding HTTP request/response),
+// in which case passing that reader avoids dropping buffered-but-unread
+// bytes.
+func (p *Proxy) spliceConn(client net.Conn, clientReader io.Reader, server net.Conn, serverReader io.Reader) {
+	metrics.ActiveTunnels.Inc()
+	defer metrics.ActiveTunnels.Dec()
+
+	in := metrics.BytesTransferred.WithLabelValues("in")
+	out := metrics.BytesTransferred.WithLabelValues("out")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer server.Close()
+		io.Copy(metrics.CountWriter(server, in), clientReader)
+	}()
+	go func() {
+		defer wg.Done()
+		defer client.Close()
+		io.Copy(metrics.CountWriter(client, out), serverReader)
+	}()
+	wg.Wait()
+}
+
+// dialBackend opens a connection to target, routing through the forwarder
+// if one is configured.
+func (p *Proxy) dialBackend(target string) (net.Conn, error) {
+	if p.Forwarder != nil {
+		return p.Forwarder.Dial("tcp", target)
+	}
+	return net.Dial("tcp", target)
+}
+
 // Connection Request Handling
-func (p *Proxy) processConnectRequest(reader *bufio.Reader) (string, string, error) {
-	target, err := p.readConnectRequest(reader)
+func (p *Proxy) processConnectRequest(reader *bufio.Reader) (target, domain, proxyAuth string, err error) {
+	target, proxyAuth, err = p.readConnectRequest(reader)
 	if err != nil {
-		return "", "", fmt.Errorf("error reading CONNECT request: %w", err)
+		return "", "", "", fmt.Errorf("error reading CONNECT request: %w", err)
 	}
 
 	// Add default port if missing
@@ -67,16 +142,16 @@ func (p *Proxy) processConnectRequest(reader *bufio.Reader) (string, string, err
 		target += ":443"
 	}
 
-	domain := strings.Split(target, ":")[0]
-	return target, domain, nil
+	domain = strings.Split(target, ":")[0]
+	return target, domain, proxyAuth, nil
 }
 
-func (p *Proxy) readConnectRequest(reader *bufio.Reader) (string, error) {
+func (p *Proxy) readConnectRequest(reader *bufio.Reader) (target, proxyAuth string, err error) {
 	var request strings.Builder
 	for {
 		line, err := reader.ReadString('\n')
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 		request.WriteString(line)
 		if line == "\r\n" {
@@ -84,13 +159,23 @@ func (p *Proxy) readConnectRequest(reader *bufio.Reader) (string, error) {
 		}
 	}
 
-	firstLine := strings.Split(request.String(), "\r\n")[0]
-	parts := strings.Split(strings.TrimSpace(firstLine), " ")
+	lines := strings.Split(request.String(), "\r\n")
+	parts := strings.Split(strings.TrimSpace(lines[0]), " ")
 	if len(parts) < 3 {
-		return "", fmt.Errorf("malformed CONNECT request")
+		return "", "", fmt.Errorf("malformed CONNECT request")
+	}
+
+	for _, line := range lines[1:] {
+		headerParts := strings.SplitN(line, ":", 2)
+		if len(headerParts) != 2 {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(headerParts[0]), "Proxy-Authorization") {
+			proxyAuth = strings.TrimSpace(headerParts[1])
+		}
 	}
 
-	return parts[1], nil
+	return parts[1], proxyAuth, nil
 }
 
 func (p *Proxy) sendForbiddenResponse(client net.Conn, domain string) {
@@ -112,12 +197,7 @@ func (p *Proxy) establishMITMTunnel(client net.Conn, target, domain string) erro
 		return fmt.Errorf("failed to send 200 response: %w", err)
 	}
 
-	rootCA, err := tls.LoadX509KeyPair("certs/rootCA.pem", "certs/rootCA.key")
-	if err != nil {
-		return fmt.Errorf("failed to load root CA: %w", err)
-	}
-
-	fakeCert, err := p.generateCertificate(domain, &rootCA)
+	fakeCert, err := p.leafCertificate(domain)
 	if err != nil {
 		return fmt.Errorf("certificate generation failed: %w", err)
 	}
@@ -133,88 +213,89 @@ func (p *Proxy) establishMITMTunnel(client net.Conn, target, domain string) erro
 	}
 
 	clientTLS := tls.Server(client, tlsConfig)
-	if err := clientTLS.Handshake(); err != nil {
+	handshakeTimer := prometheus.NewTimer(metrics.TLSHandshakeDuration)
+	err = clientTLS.Handshake()
+	handshakeTimer.ObserveDuration()
+	if err != nil {
 		return fmt.Errorf("TLS handshake failed: %w", err)
 	}
 
-	serverTLS, err := tls.Dial("tcp", target, &tls.Config{
-		InsecureSkipVerify: true,
-	})
+	serverConn, err := p.dialBackend(target)
 	if err != nil {
+		metrics.UpstreamDialErrors.Inc()
 		return fmt.Errorf("failed to connect to target: %w", err)
 	}
+
+	serverTLS := tls.Client(serverConn, &tls.Config{
+		InsecureSkipVerify: true,
+	})
 	defer serverTLS.Close()
 
+	metrics.ActiveTunnels.Inc()
+	defer metrics.ActiveTunnels.Dec()
+
 	p.tunnelConnections(clientTLS, serverTLS)
 	return nil
 }
 
-// Certificate Generation
-func (p *Proxy) generateCertificate(domain string, rootCA *tls.Certificate) (tls.Certificate, error) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return tls.Certificate{}, err
+// leafCertificate returns a MITM leaf certificate for domain, using the
+// configured CertStore (cached, coalesced, ECDSA by default) if one was
+// supplied via WithCertStore, or otherwise a default Store lazily loaded
+// from the on-disk "certs" directory.
+func (p *Proxy) leafCertificate(domain string) (tls.Certificate, error) {
+	cs := p.defaultCertStore()
+	if cs == nil {
+		return tls.Certificate{}, fmt.Errorf("loading default cert store: certstore.New failed")
 	}
+	return cs.GetCertificate(domain)
+}
 
-	cleanDomain := strings.Split(domain, ":")[0]
-	h := sha256.New()
-	h.Write([]byte(domain))
-	h.Write([]byte(time.Now().Format(time.RFC3339Nano)))
-	serial := new(big.Int).SetBytes(h.Sum(nil))
-
-	template := x509.Certificate{
-		SerialNumber: serial,
-		Subject: pkix.Name{
-			CommonName: cleanDomain,
-		},
-		DNSNames:              []string{cleanDomain, "*." + cleanDomain},
-		NotBefore:             time.Now().Add(-5 * time.Minute),
-		NotAfter:              time.Now().Add(2 * time.Hour),
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		BasicConstraintsValid: true,
-		IsCA:                  false,
-		SubjectKeyId:          []byte{1, 2, 3, 4},
-	}
+// defaultCertStore returns p.CertStore, lazily initializing it from an
+// on-disk "certs" root CA if Proxy was constructed without WithCertStore.
+// Locked because leafCertificate can be called concurrently from multiple
+// client connections.
+func (p *Proxy) defaultCertStore() *certstore.Store {
+	p.certStoreMu.Lock()
+	defer p.certStoreMu.Unlock()
 
-	signedCert, err := x509.CreateCertificate(
-		rand.Reader,
-		&template,
-		rootCA.Leaf,
-		&privateKey.PublicKey,
-		rootCA.PrivateKey,
-	)
-	if err != nil {
-		return tls.Certificate{}, err
+	if p.CertStore == nil {
+		cs, err := certstore.New("certs")
+		if err != nil {
+			p.Logger.Error("Failed to load default cert store", zap.Error(err))
+			return nil
+		}
+		p.CertStore = cs
 	}
-
-	return tls.Certificate{
-		Certificate: [][]byte{signedCert},
-		PrivateKey:  privateKey,
-	}, nil
+	return p.CertStore
 }
 
 // Connection Tunneling
 func (p *Proxy) tunnelConnections(client, server net.Conn) {
+	in := metrics.BytesTransferred.WithLabelValues("in")
+	out := metrics.BytesTransferred.WithLabelValues("out")
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
 		defer server.Close()
-		io.Copy(server, client)
+		n, _ := io.Copy(metrics.CountWriter(server, in), client)
+		if ce := p.Logger.Check(zap.DebugLevel, "client->server tunnel closed"); ce != nil {
+			ce.Write(zap.Int64("bytes", n))
+		}
 	}()
 
 	go func() {
 		defer wg.Done()
 		defer client.Close()
-		p.forwardServerResponse(client, server)
+		p.forwardServerResponse(metrics.CountWriter(client, out), server)
 	}()
 
 	wg.Wait()
 }
 
-func (p *Proxy) forwardServerResponse(client, server net.Conn) {
+func (p *Proxy) forwardServerResponse(client io.Writer, server net.Conn) {
 	serverReader := bufio.NewReader(server)
 	headers, err := p.readServerResponse(serverReader)
 	if err != nil {
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"github.com/mohamedbeat/gyxy/acl"
+	"github.com/mohamedbeat/gyxy/auth"
+	"github.com/mohamedbeat/gyxy/certstore"
+	"github.com/mohamedbeat/gyxy/forwarder"
+)
+
+// Option configures a Proxy created with New.
+type Option func(*Proxy)
+
+// WithAuth enables proxy authentication using a. Requests that fail
+// validation are rejected with 407 Proxy Authentication Required.
+func WithAuth(a auth.Auth) Option {
+	return func(p *Proxy) {
+		p.Auth = a
+	}
+}
+
+// WithUpstream routes outbound connections through f instead of dialing
+// origins directly.
+func WithUpstream(f *forwarder.Forwarder) Option {
+	return func(p *Proxy) {
+		p.Forwarder = f
+	}
+}
+
+// WithCertStore mints and caches MITM leaf certificates from cs instead of
+// the default Store lazily loaded from the on-disk "certs" directory.
+func WithCertStore(cs *certstore.Store) Option {
+	return func(p *Proxy) {
+		p.CertStore = cs
+	}
+}
+
+// WithACL enables host access control using e, replacing the legacy
+// `blocked` file scan.
+func WithACL(e *acl.Engine) Option {
+	return func(p *Proxy) {
+		p.ACL = e
+	}
+}
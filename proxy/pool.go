@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// idleTimeout bounds how long a pooled upstream connection sits unused
+// before it's dropped rather than reused.
+const idleTimeout = 90 * time.Second
+
+// connPool keeps idle upstream connections around per "host:port" so
+// repeated requests to the same origin can reuse an existing TCP+TLS
+// session instead of paying dial/handshake latency again.
+type connPool struct {
+	mu   sync.Mutex
+	idle map[string][]pooledConn
+}
+
+type pooledConn struct {
+	net.Conn
+	lastUsed     time.Time
+	absoluteForm bool
+}
+
+func newConnPool() *connPool {
+	return &connPool{idle: make(map[string][]pooledConn)}
+}
+
+// get returns an idle connection for key, if one exists and hasn't timed
+// out, along with whether requests over it must be written in absolute-form
+// (i.e. it goes to a parent HTTP proxy rather than the origin directly).
+func (p *connPool) get(key string) (conn net.Conn, absoluteForm bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conns := p.idle[key]
+	for len(conns) > 0 {
+		c := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		p.idle[key] = conns
+
+		if time.Since(c.lastUsed) < idleTimeout {
+			return c.Conn, c.absoluteForm
+		}
+		c.Conn.Close()
+	}
+	return nil, false
+}
+
+// put returns conn to the pool for reuse under key, remembering whether it
+// must be written to in absolute-form so a subsequent request over the same
+// connection is framed the same way it was dialed.
+func (p *connPool) put(key string, conn net.Conn, absoluteForm bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.idle[key] = append(p.idle[key], pooledConn{Conn: conn, lastUsed: time.Now(), absoluteForm: absoluteForm})
+}
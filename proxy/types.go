@@ -1,27 +1,26 @@
 package proxy
 
-import "go.uber.org/zap"
+import (
+	"sync"
 
-type HTTPRequest struct {
-	Method          string
-	Path            string
-	Protocol        string
-	Port            string
-	Host            string
-	UserAgent       string
-	ProxyConnection string
-	Raw             string
-}
+	"go.uber.org/zap"
 
-type HTTPResponse struct {
-	Proto       string
-	StatusCode  int
-	Status      string
-	Headers     map[string]string
-	Body        []byte
-	RawResponse []byte
-}
+	"github.com/mohamedbeat/gyxy/acl"
+	"github.com/mohamedbeat/gyxy/auth"
+	"github.com/mohamedbeat/gyxy/certstore"
+	"github.com/mohamedbeat/gyxy/forwarder"
+)
 
 type Proxy struct {
-	Logger *zap.Logger
+	Logger    *zap.Logger
+	Auth      auth.Auth
+	Forwarder *forwarder.Forwarder
+	CertStore *certstore.Store
+	ACL       *acl.Engine
+
+	pool *connPool
+
+	// certStoreMu guards lazy-initializing CertStore when a Proxy is used
+	// without WithCertStore; see leafCertificate.
+	certStoreMu sync.Mutex
 }